@@ -2,19 +2,30 @@ package internal
 
 import (
 	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
 
+	"github.com/BurntSushi/toml"
 	"github.com/spf13/afero"
+	"gopkg.in/yaml.v3"
 )
 
 var titleRe = regexp.MustCompile(`#+(.*)`)
 var imageRe = regexp.MustCompile(`!\[.*]\((.+)\)`)
 
+const (
+	yamlDelim = "---"
+	tomlDelim = "+++"
+)
+
 // File is an abstraction representing a Markdown file
 // All fields are populated by NewFile constructor.
 type File struct {
@@ -22,6 +33,7 @@ type File struct {
 	Path string
 
 	Title       string
+	Frontmatter map[string]any
 	Attachments []string
 }
 
@@ -38,9 +50,19 @@ func NewFile(fs afero.Fs, path string) (*File, error) {
 		}
 	}()
 
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read a source file: %w", err)
+	}
+
+	frontmatter, body, err := parseFrontmatter(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse frontmatter in %s: %w", path, err)
+	}
+
 	var title string
 	var attachments []string
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(bytes.NewReader(body))
 
 	for scanner.Scan() {
 		if title == "" {
@@ -56,76 +78,371 @@ func NewFile(fs afero.Fs, path string) (*File, error) {
 		fs: fs,
 
 		Title:       title,
+		Frontmatter: frontmatter,
 		Path:        path,
 		Attachments: attachments,
 	}, nil
 }
 
-// Move file to a new destination.
-func (f *File) Move(dest string) error {
+// parseFrontmatter detects and decodes a YAML (`---`), TOML (`+++`) or JSON
+// (`{`) frontmatter block at the beginning of content, returning the decoded
+// values and the remaining body with the block stripped off.
+func parseFrontmatter(content []byte) (map[string]any, []byte, error) {
+	switch {
+	case bytes.HasPrefix(content, []byte(yamlDelim)):
+		return parseDelimitedFrontmatter(content, yamlDelim, yaml.Unmarshal)
+	case bytes.HasPrefix(content, []byte(tomlDelim)):
+		return parseDelimitedFrontmatter(content, tomlDelim, func(b []byte, v any) error {
+			return toml.Unmarshal(b, v)
+		})
+	case bytes.HasPrefix(bytes.TrimSpace(content), []byte("{")):
+		return parseJSONFrontmatter(content)
+	default:
+		return nil, content, nil
+	}
+}
+
+// parseDelimitedFrontmatter decodes a frontmatter block fenced by a pair of
+// lines equal to delim (e.g. "---" or "+++"), using unmarshal to decode the
+// lines in between.
+func parseDelimitedFrontmatter(content []byte, delim string, unmarshal func([]byte, any) error) (map[string]any, []byte, error) {
+	lines := bytes.Split(content, []byte("\n"))
+	if strings.TrimSpace(string(lines[0])) != delim {
+		return nil, content, nil
+	}
+
+	end := -1
+	for i := 1; i < len(lines); i++ {
+		if strings.TrimSpace(string(lines[i])) == delim {
+			end = i
+			break
+		}
+	}
+	if end == -1 {
+		return nil, content, fmt.Errorf("unterminated frontmatter block, expected closing %q", delim)
+	}
+
+	var frontmatter map[string]any
+	raw := bytes.Join(lines[1:end], []byte("\n"))
+	if len(bytes.TrimSpace(raw)) > 0 {
+		if err := unmarshal(raw, &frontmatter); err != nil {
+			return nil, content, err
+		}
+	}
+
+	return frontmatter, bytes.Join(lines[end+1:], []byte("\n")), nil
+}
+
+// parseJSONFrontmatter decodes a single JSON object at the start of content
+// and returns everything after it as the remaining body.
+func parseJSONFrontmatter(content []byte) (map[string]any, []byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(content))
+	var frontmatter map[string]any
+	if err := dec.Decode(&frontmatter); err != nil {
+		return nil, content, err
+	}
+
+	return frontmatter, content[dec.InputOffset():], nil
+}
+
+// Move file to a new destination. When keepSource is true, the source file
+// and its attachments are left in place (copied rather than moved), for a
+// non-destructive "publish" style invocation.
+func (f *File) Move(dest string, keepSource bool) error {
 	if exists, err := afero.Exists(f.fs, dest); exists && err == nil {
 		file := filepath.Base(dest)
 		log.Printf("[WARN] file already exists %s", file)
 	}
 
-	if err := ensureDir(f.fs, dest); err != nil {
+	if err := Apply(f.fs, f.PlanMove(dest), keepSource); err != nil {
 		return err
 	}
+	f.Path = dest
 
-	if err := f.fs.Rename(f.Path, dest); err != nil {
-		return fmt.Errorf("failed to move the file: %w", err)
-	}
-	defer func() { f.Path = dest }()
+	return nil
+}
+
+// PlanMove previews the Actions Move(dest, ...) would perform, without
+// touching the filesystem. Attachments are only planned to move alongside
+// the file when it changes directory, mirroring Move.
+func (f *File) PlanMove(dest string) []Action {
+	var actions []Action
 
 	dir := filepath.Dir(f.Path)
-	if dir == filepath.Dir(dest) || len(f.Attachments) == 0 {
-		return nil
+	if dir != filepath.Dir(dest) {
+		for _, attachment := range f.Attachments {
+			attachmentDest := filepath.Join(filepath.Dir(dest), attachment)
+			actions = append(actions, Action{
+				Kind: ActionRenameAttachment,
+				Src:  filepath.Join(dir, attachment),
+				Dest: attachmentDest,
+			})
+		}
 	}
 
-	for _, attachment := range f.Attachments {
-		destDir := filepath.Dir(dest)
-		attachmentDest := filepath.Join(destDir, attachment)
+	return append(actions, Action{Kind: ActionRenameFile, Src: f.Path, Dest: dest})
+}
 
-		if err := ensureDir(f.fs, attachmentDest); err != nil {
-			return err
-		}
+// DedupeMode controls how MoveToDir resolves a filename collision at the
+// destination.
+type DedupeMode string
+
+const (
+	// DedupeOff performs no collision handling at all: a colliding
+	// destination file is silently overwritten.
+	DedupeOff DedupeMode = "off"
+	// DedupeContent compares the content of the colliding file with the
+	// source via a sha256 digest. Identical files are deduplicated (the
+	// source is removed instead of moved); different files fall back to
+	// DedupeName's numeric suffix.
+	DedupeContent DedupeMode = "content"
+	// DedupeName always resolves a collision with a numeric suffix,
+	// without comparing content.
+	DedupeName DedupeMode = "name"
+)
+
+// MoveToDir moves file to a new directory. When keepSource is true, the
+// source file and its attachments are left in place (copied rather than
+// moved); content deduplication is skipped in that case, since its whole
+// purpose is to remove a redundant source.
+func (f *File) MoveToDir(dirName string, dedupe DedupeMode, keepSource bool) error {
+	actions, err := f.PlanMoveToDir(dirName, dedupe, keepSource)
+	if err != nil {
+		return err
+	}
+
+	if err := Apply(f.fs, actions, keepSource); err != nil {
+		return err
+	}
 
-		if err := f.fs.Rename(filepath.Join(dir, attachment), attachmentDest); err != nil {
-			return fmt.Errorf("failed to move the attachment: %w", err)
+	for _, action := range actions {
+		if action.Kind == ActionRenameFile {
+			f.Path = action.Dest
 		}
 	}
 
 	return nil
 }
 
-// MoveToDir moves file to a new directory.
-func (f *File) MoveToDir(dirName string) error {
-	dest := f.uniqueName(filepath.Join(dirName, filepath.Base(f.Path)))
-	if err := f.fs.Rename(f.Path, dest); err != nil {
-		return fmt.Errorf("failed to move a file: %w", err)
+// PlanMoveToDir previews the Actions MoveToDir(dirName, dedupe, ...) would
+// perform, without touching the filesystem. When keepSource is true, content
+// deduplication is skipped, since its whole purpose is to remove a source
+// that Apply would otherwise keep.
+func (f *File) PlanMoveToDir(dirName string, dedupe DedupeMode, keepSource bool) ([]Action, error) {
+	return f.PlanMoveTo(filepath.Join(dirName, filepath.Base(f.Path)), dedupe, keepSource)
+}
+
+// PlanMoveTo previews the Actions a move to the exact destination dest would
+// perform, applying the same collision handling as PlanMoveToDir (see
+// DedupeMode) instead of assuming dest is free. It's used wherever a
+// destination is computed per file, e.g. from a template, so a collision
+// between two resolved destinations is caught instead of one silently
+// overwriting the other.
+func (f *File) PlanMoveTo(dest string, dedupe DedupeMode, keepSource bool) ([]Action, error) {
+	if dedupe == DedupeContent && !keepSource {
+		deduped, err := f.WouldDeduplicate(dest)
+		if err != nil {
+			return nil, err
+		}
+		if deduped {
+			return []Action{{Kind: ActionDedupe, Src: f.Path, Dest: dest}}, nil
+		}
 	}
-	if len(f.Attachments) == 0 {
-		return nil
+
+	if dedupe != DedupeOff {
+		dest = f.uniqueName(dest)
 	}
 
+	var actions []Action
+	dir := filepath.Dir(f.Path)
+	destDir := filepath.Dir(dest)
+
 	for _, attachment := range f.Attachments {
-		src := filepath.Join(filepath.Dir(f.Path), attachment)
-		dest := filepath.Join(dirName, attachment)
+		src := filepath.Join(dir, attachment)
 
 		if exists, err := afero.Exists(f.fs, src); !exists && err == nil {
 			log.Printf("[WARN] attachment is missing: %s", src)
 			continue
 		}
 
-		if err := ensureDir(f.fs, dest); err != nil {
-			return err
+		actions = append(actions, Action{
+			Kind: ActionRenameAttachment,
+			Src:  src,
+			Dest: filepath.Join(destDir, attachment),
+		})
+	}
+
+	return append(actions, Action{Kind: ActionRenameFile, Src: f.Path, Dest: dest}), nil
+}
+
+// WouldDeduplicate reports whether the content at dest is identical to f's,
+// including every attachment referenced from it, without modifying the
+// filesystem. If dest doesn't exist yet, it reports false so the caller
+// proceeds with a normal move.
+func (f *File) WouldDeduplicate(dest string) (bool, error) {
+	exists, err := afero.Exists(f.fs, dest)
+	if err != nil || !exists {
+		return false, err
+	}
+
+	same, err := sameContent(f.fs, f.Path, dest)
+	if err != nil {
+		return false, fmt.Errorf("failed to compare %s with %s: %w", f.Path, dest, err)
+	}
+	if !same {
+		return false, nil
+	}
+
+	return f.attachmentsMatch(dest)
+}
+
+// attachmentsMatch reports whether every attachment referenced from f is
+// identical to its counterpart alongside dest. A match on the document body
+// alone isn't enough to call two files duplicates: they can share the same
+// text while embedding a same-named attachment with unrelated content, and
+// deduplicating would silently discard the source's copy.
+func (f *File) attachmentsMatch(dest string) (bool, error) {
+	srcDir := filepath.Dir(f.Path)
+	destDir := filepath.Dir(dest)
+
+	for _, attachment := range f.Attachments {
+		src := filepath.Join(srcDir, attachment)
+		dst := filepath.Join(destDir, attachment)
+
+		srcExists, err := afero.Exists(f.fs, src)
+		if err != nil {
+			return false, err
+		}
+		dstExists, err := afero.Exists(f.fs, dst)
+		if err != nil {
+			return false, err
+		}
+		if srcExists != dstExists {
+			return false, nil
+		}
+		if !srcExists {
+			continue
 		}
 
-		if err := f.fs.Rename(filepath.Join(filepath.Dir(f.Path), attachment), dest); err != nil {
-			return fmt.Errorf("failed to move an attachment: %w", err)
+		same, err := sameContent(f.fs, src, dst)
+		if err != nil {
+			return false, fmt.Errorf("failed to compare %s with %s: %w", src, dst, err)
+		}
+		if !same {
+			return false, nil
 		}
 	}
 
+	return true, nil
+}
+
+// sameContent reports whether the files at a and b have identical content,
+// comparing sha256 digests computed by streaming both through io.Copy so
+// large files don't need to fit in memory.
+func sameContent(fs afero.Fs, a, b string) (bool, error) {
+	ha, err := hashFile(fs, a)
+	if err != nil {
+		return false, err
+	}
+
+	hb, err := hashFile(fs, b)
+	if err != nil {
+		return false, err
+	}
+
+	return bytes.Equal(ha, hb), nil
+}
+
+// hashFile streams path through sha256 and returns the resulting digest.
+func hashFile(fs afero.Fs, path string) ([]byte, error) {
+	file, err := fs.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s for hashing: %w", path, err)
+	}
+	defer func() { _ = file.Close() }()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return nil, fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+
+	return h.Sum(nil), nil
+}
+
+// stageMove moves src to dest, preferring an atomic fs.Rename and falling
+// back to crossDeviceCopy when it fails (e.g. EXDEV across a mount point or
+// a Docker volume). On the fallback path dest is fully written but src is
+// left untouched; the returned unlink func removes src and must be called
+// by the caller only once every file in a larger move has staged
+// successfully, so a failure partway through leaves the source tree intact.
+// When keepSource is true, src is always copied rather than renamed, since
+// fs.Rename would remove it immediately regardless of the caller's intent.
+func stageMove(fs afero.Fs, src, dest string, keepSource bool) (unlink func() error, err error) {
+	if err := ensureDir(fs, dest); err != nil {
+		return nil, err
+	}
+
+	if !keepSource {
+		if err := fs.Rename(src, dest); err == nil {
+			return func() error { return nil }, nil
+		}
+	}
+
+	if err := crossDeviceCopy(fs, src, dest); err != nil {
+		return nil, err
+	}
+
+	return func() error { return fs.Remove(src) }, nil
+}
+
+// crossDeviceCopy copies src to dest when fs.Rename can't move the file
+// atomically. It streams the content through io.Copy, calls Sync on the
+// destination before Close, and preserves the source's mode and mtime. The
+// source is left untouched, and any partially written dest is removed if
+// the copy fails.
+func crossDeviceCopy(fs afero.Fs, src, dest string) (err error) {
+	info, err := fs.Stat(src)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", src, err)
+	}
+
+	in, err := fs.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer func() { _ = in.Close() }()
+
+	out, err := fs.Create(dest)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dest, err)
+	}
+	defer func() {
+		if err != nil {
+			_ = fs.Remove(dest)
+		}
+	}()
+
+	if _, err = io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return fmt.Errorf("failed to copy %s to %s: %w", src, dest, err)
+	}
+
+	if err = out.Sync(); err != nil {
+		_ = out.Close()
+		return fmt.Errorf("failed to sync %s: %w", dest, err)
+	}
+
+	if err = out.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", dest, err)
+	}
+
+	if err = fs.Chmod(dest, info.Mode()); err != nil {
+		return fmt.Errorf("failed to preserve mode on %s: %w", dest, err)
+	}
+	if err = fs.Chtimes(dest, info.ModTime(), info.ModTime()); err != nil {
+		return fmt.Errorf("failed to preserve mtime on %s: %w", dest, err)
+	}
+
 	return nil
 }
 
@@ -1,12 +1,25 @@
 package internal
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/require"
 )
 
+// renameFailsFs wraps an afero.Fs and makes every Rename fail, simulating an
+// EXDEV error as if src and dest lived on two different devices (e.g. two
+// stacked afero.NewBasePathFs roots mounted over separate filesystems), so
+// tests can exercise the copy+unlink fallback instead of the atomic path.
+type renameFailsFs struct {
+	afero.Fs
+}
+
+func (renameFailsFs) Rename(string, string) error {
+	return errors.New("simulated EXDEV: cross-device link")
+}
+
 func TestNewFileParsing(t *testing.T) {
 	file, err := NewFile(afero.NewOsFs(), "testdata/sample.md")
 
@@ -19,3 +32,68 @@ func TestNewFileParsing(t *testing.T) {
 	require.Len(t, file.Attachments, 1, "exactly one attachment")
 	require.Contains(t, file.Attachments, "images/sample.png")
 }
+
+func TestNewFileFrontmatter(t *testing.T) {
+	file, err := NewFile(afero.NewOsFs(), "testdata/frontmatter.md")
+
+	require.NoError(t, err)
+
+	require.Equal(t, "Different H1 heading", file.Title, "H1 title is still scanned")
+
+	require.Equal(t, "Custom Title", file.Frontmatter["title"])
+	require.Equal(t, "custom-slug", file.Frontmatter["slug"])
+
+	taxonomies, ok := file.Frontmatter["taxonomies"].(map[string]any)
+	require.True(t, ok, "nested table should decode to map[string]any")
+	require.Equal(t, "guides", taxonomies["category"])
+
+	require.NotEmpty(t, file.Attachments, "attachments should still be scanned after frontmatter")
+	require.Contains(t, file.Attachments, "images/sample.png")
+}
+
+func TestMoveCrossDevice(t *testing.T) {
+	mem := afero.NewMemMapFs()
+	fs := renameFailsFs{mem}
+	require.NoError(t, afero.WriteFile(fs, "src/note.md", []byte("# Note\n\n![img](images/pic.png)\n"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "src/images/pic.png", []byte("fake-png-bytes"), 0o644))
+
+	file, err := NewFile(fs, "src/note.md")
+	require.NoError(t, err)
+
+	err = file.Move("dest/note.md", false)
+	require.NoError(t, err)
+
+	require.Equal(t, "dest/note.md", file.Path)
+	require.False(t, exists(t, fs, "src/note.md"), "source should be removed after a successful copy fallback")
+	require.False(t, exists(t, fs, "src/images/pic.png"), "attachment source should be removed too")
+
+	content, err := afero.ReadFile(fs, "dest/note.md")
+	require.NoError(t, err)
+	require.Contains(t, string(content), "# Note")
+
+	attachment, err := afero.ReadFile(fs, "dest/images/pic.png")
+	require.NoError(t, err)
+	require.Equal(t, "fake-png-bytes", string(attachment))
+}
+
+func TestMoveCrossDeviceKeepSource(t *testing.T) {
+	mem := afero.NewMemMapFs()
+	fs := renameFailsFs{mem}
+	require.NoError(t, afero.WriteFile(fs, "src/note.md", []byte("# Note\n"), 0o644))
+
+	file, err := NewFile(fs, "src/note.md")
+	require.NoError(t, err)
+
+	err = file.Move("dest/note.md", true)
+	require.NoError(t, err)
+
+	require.True(t, exists(t, fs, "src/note.md"), "source should be kept when keepSource is true")
+	require.True(t, exists(t, fs, "dest/note.md"), "destination should still be written")
+}
+
+func exists(t *testing.T, fs afero.Fs, path string) bool {
+	t.Helper()
+	ok, err := afero.Exists(fs, path)
+	require.NoError(t, err)
+	return ok
+}
@@ -0,0 +1,209 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// inlineLinkRe matches inline Markdown links and images: [text](target) or
+// ![alt](target "optional title").
+var inlineLinkRe = regexp.MustCompile(`(!?)\[([^\]]*)]\(([^)\s]+)([^)]*)\)`)
+
+// refLinkRe matches reference-style link definitions: [id]: target
+var refLinkRe = regexp.MustCompile(`(?m)^(\s*\[[^\]]+]:\s*)(\S+)`)
+
+// rewriteLinkTargets runs resolve over every relative link, image and
+// reference-style target in content, replacing it when resolve reports ok.
+// It returns the updated content and the number of targets that were rewritten.
+func rewriteLinkTargets(content []byte, resolve func(target string) (string, bool)) ([]byte, int) {
+	count := 0
+
+	out := inlineLinkRe.ReplaceAllFunc(content, func(match []byte) []byte {
+		m := inlineLinkRe.FindSubmatch(match)
+		bang, text, target, rest := m[1], m[2], m[3], m[4]
+
+		newTarget, ok := resolve(string(target))
+		if !ok {
+			return match
+		}
+		count++
+
+		return []byte(fmt.Sprintf("%s[%s](%s%s)", bang, text, newTarget, rest))
+	})
+
+	out = refLinkRe.ReplaceAllFunc(out, func(match []byte) []byte {
+		m := refLinkRe.FindSubmatch(match)
+		prefix, target := m[1], m[2]
+
+		newTarget, ok := resolve(string(target))
+		if !ok {
+			return match
+		}
+		count++
+
+		return append(append([]byte{}, prefix...), []byte(newTarget)...)
+	})
+
+	return out, count
+}
+
+// splitTarget separates a link target's path portion from a trailing
+// fragment (#...) or query (?...), which is preserved verbatim.
+func splitTarget(target string) (path, suffix string) {
+	if i := strings.IndexAny(target, "#?"); i >= 0 {
+		return target[:i], target[i:]
+	}
+	return target, ""
+}
+
+// isRewritableTarget reports whether a link target is a relative filesystem
+// path we can safely recompute, as opposed to an absolute path or a URL with
+// a scheme (https://, mailto:, ...).
+func isRewritableTarget(path string) bool {
+	if path == "" || filepath.IsAbs(path) {
+		return false
+	}
+	return !strings.Contains(path, "://") && !strings.HasPrefix(path, "mailto:")
+}
+
+// RewriteLinks updates relative link, image and reference targets inside the
+// file so they keep resolving after the file moved from oldDir to its
+// current directory. Links pointing at the file's own attachments are left
+// untouched, since attachments are relocated alongside the file under the
+// same relative path.
+func (f *File) RewriteLinks(oldDir string) (int, error) {
+	newDir := filepath.Dir(f.Path)
+	if oldDir == newDir {
+		return 0, nil
+	}
+
+	attachments := make(map[string]struct{}, len(f.Attachments))
+	for _, a := range f.Attachments {
+		attachments[a] = struct{}{}
+	}
+
+	content, err := afero.ReadFile(f.fs, f.Path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s for link rewriting: %w", f.Path, err)
+	}
+
+	rewritten, count := rewriteLinkTargets(content, func(target string) (string, bool) {
+		path, suffix := splitTarget(target)
+		if _, isAttachment := attachments[path]; isAttachment || !isRewritableTarget(path) {
+			return "", false
+		}
+
+		rel, err := filepath.Rel(newDir, filepath.Join(oldDir, path))
+		if err != nil {
+			return "", false
+		}
+
+		return filepath.ToSlash(rel) + suffix, true
+	})
+
+	if count == 0 {
+		return 0, nil
+	}
+
+	if err := afero.WriteFile(f.fs, f.Path, rewritten, os.ModePerm); err != nil {
+		return 0, fmt.Errorf("failed to write %s after link rewriting: %w", f.Path, err)
+	}
+	log.Printf("[INFO] rewrote %d link(s) in %s", count, f.Path)
+
+	return count, nil
+}
+
+// PreviewReferenceRewrites reports the path of every file under root that
+// RewriteReferences would rewrite for the given moves, without modifying
+// anything.
+func PreviewReferenceRewrites(fs afero.Fs, root string, moves map[string]string) ([]string, error) {
+	var touched []string
+
+	err := afero.Walk(fs, root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(path) != ".md" {
+			return nil
+		}
+
+		dir := filepath.Dir(path)
+		content, err := afero.ReadFile(fs, path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+
+		_, count := rewriteLinkTargets(content, func(target string) (string, bool) {
+			targetPath, _ := splitTarget(target)
+			if !isRewritableTarget(targetPath) {
+				return "", false
+			}
+
+			_, moved := moves[filepath.Clean(filepath.Join(dir, targetPath))]
+			return "", moved
+		})
+
+		if count > 0 {
+			touched = append(touched, path)
+		}
+		return nil
+	})
+
+	return touched, err
+}
+
+// RewriteReferences scans every *.md file under root and rewrites any link,
+// image or reference target that resolves to one of the moved files (keyed
+// by their original path in moves, valued by their new path).
+func RewriteReferences(fs afero.Fs, root string, moves map[string]string) error {
+	return afero.Walk(fs, root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(path) != ".md" {
+			return nil
+		}
+
+		dir := filepath.Dir(path)
+		content, err := afero.ReadFile(fs, path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+
+		rewritten, count := rewriteLinkTargets(content, func(target string) (string, bool) {
+			targetPath, suffix := splitTarget(target)
+			if !isRewritableTarget(targetPath) {
+				return "", false
+			}
+
+			newPath, moved := moves[filepath.Clean(filepath.Join(dir, targetPath))]
+			if !moved {
+				return "", false
+			}
+
+			rel, err := filepath.Rel(dir, newPath)
+			if err != nil {
+				return "", false
+			}
+
+			return filepath.ToSlash(rel) + suffix, true
+		})
+
+		if count == 0 {
+			return nil
+		}
+
+		if err := afero.WriteFile(fs, path, rewritten, os.ModePerm); err != nil {
+			return fmt.Errorf("failed to write %s after link rewriting: %w", path, err)
+		}
+		log.Printf("[INFO] rewrote %d link(s) in %s", count, path)
+
+		return nil
+	})
+}
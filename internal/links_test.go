@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileRewriteLinks(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "src/note.md", []byte(
+		"# Note\n\nSee [other note](other.md) and ![img](images/pic.png).\n",
+	), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "src/other.md", []byte("# Other\n"), 0o644))
+
+	file, err := NewFile(fs, "src/note.md")
+	require.NoError(t, err)
+	file.Attachments = []string{"images/pic.png"}
+
+	require.NoError(t, fs.MkdirAll("dest", 0o755))
+	require.NoError(t, fs.Rename("src/note.md", "dest/note.md"))
+	file.Path = "dest/note.md"
+
+	count, err := file.RewriteLinks("src")
+	require.NoError(t, err)
+	require.Equal(t, 1, count, "only the non-attachment link should be rewritten")
+
+	content, err := afero.ReadFile(fs, "dest/note.md")
+	require.NoError(t, err)
+	require.Contains(t, string(content), "[other note](../src/other.md)")
+	require.Contains(t, string(content), "![img](images/pic.png)", "attachment links are left untouched")
+}
+
+func TestRewriteReferences(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "note.md", []byte("# Note\n"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "refs.md", []byte(
+		"# References\n\nSee [the note](note.md#section) for details.\n",
+	), 0o644))
+
+	moves := map[string]string{"note.md": "archive/note.md"}
+
+	err := RewriteReferences(fs, ".", moves)
+	require.NoError(t, err)
+
+	content, err := afero.ReadFile(fs, "refs.md")
+	require.NoError(t, err)
+	require.Contains(t, string(content), "[the note](archive/note.md#section)", "fragment should be preserved")
+}
@@ -0,0 +1,154 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/afero"
+)
+
+// ActionKind identifies the filesystem operation a planned Action performs.
+type ActionKind string
+
+const (
+	// ActionRenameFile moves a markdown file from Src to Dest.
+	ActionRenameFile ActionKind = "rename_file"
+	// ActionRenameAttachment moves a file referenced by a markdown file from Src to Dest.
+	ActionRenameAttachment ActionKind = "rename_attachment"
+	// ActionDedupe removes Src because its content is identical to the
+	// existing file at Dest.
+	ActionDedupe ActionKind = "dedupe"
+	// ActionRewriteLink updates relative links inside the file at Dest so
+	// they keep resolving after a move. Src carries the directory the links
+	// are rewritten relative to (the mover's old directory, for a file
+	// rewriting its own links, or unused for other files referencing a
+	// moved one).
+	ActionRewriteLink ActionKind = "rewrite_link"
+	// ActionRemoveEmptyDir removes Src once it's empty, after every other
+	// action has run.
+	ActionRemoveEmptyDir ActionKind = "remove_empty_dir"
+)
+
+// Action is a single filesystem operation computed by Plan, PlanMove or
+// PlanMoveToDir. Apply executes a slice of Actions, in order, to perform the
+// move they describe.
+type Action struct {
+	Kind ActionKind `json:"kind"`
+	Src  string     `json:"src,omitempty"`
+	Dest string     `json:"dest,omitempty"`
+}
+
+// Apply executes actions built by Plan/PlanMove/PlanMoveToDir against fs, in
+// order. Every ActionRenameFile, ActionRenameAttachment and ActionDedupe only
+// removes its source at the very end (ActionRenameFile/ActionRenameAttachment
+// stage the destination first, preferring an atomic fs.Rename and falling
+// back to a streamed copy, see stageMove; ActionDedupe reads the source's
+// attachments up front, see prepareDeduplicatedRemoval), so a failure
+// partway through leaves the source tree intact. When keepSource is true,
+// sources are kept: renames copy instead of moving, ActionDedupe and
+// ActionRemoveEmptyDir are skipped entirely.
+func Apply(fs afero.Fs, actions []Action, keepSource bool) error {
+	var unlinks []func() error
+
+	for _, action := range actions {
+		switch action.Kind {
+		case ActionRenameFile, ActionRenameAttachment:
+			unlink, err := stageMove(fs, action.Src, action.Dest, keepSource)
+			if err != nil {
+				return fmt.Errorf("failed to move %s: %w", action.Src, err)
+			}
+			unlinks = append(unlinks, unlink)
+
+		case ActionDedupe:
+			if keepSource {
+				continue
+			}
+			unlink, err := prepareDeduplicatedRemoval(fs, action.Src, action.Dest)
+			if err != nil {
+				return err
+			}
+			unlinks = append(unlinks, unlink)
+
+		case ActionRewriteLink:
+			file, err := NewFile(fs, action.Dest)
+			if err != nil {
+				return fmt.Errorf("failed to read %s for link rewriting: %w", action.Dest, err)
+			}
+			if _, err := file.RewriteLinks(action.Src); err != nil {
+				return err
+			}
+
+		case ActionRemoveEmptyDir:
+			if keepSource {
+				continue
+			}
+			if err := removeEmptyDir(fs, action.Src); err != nil {
+				return err
+			}
+		}
+	}
+
+	if keepSource {
+		return nil
+	}
+
+	for _, unlink := range unlinks {
+		if err := unlink(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// prepareDeduplicatedRemoval reads src's attachments up front and returns a
+// func that removes src and those attachments, used to apply an
+// ActionDedupe. Like stageMove's unlink, the returned func is only meant to
+// be called once every action in the batch has succeeded, so a later
+// failure doesn't leave src gone while other pending actions haven't run.
+func prepareDeduplicatedRemoval(fs afero.Fs, src, dest string) (func() error, error) {
+	file, err := NewFile(fs, src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s for deduplication: %w", src, err)
+	}
+
+	return func() error {
+		if err := fs.Remove(src); err != nil {
+			return fmt.Errorf("failed to remove a deduplicated file: %w", err)
+		}
+
+		for _, attachment := range file.Attachments {
+			attachmentSrc := filepath.Join(filepath.Dir(src), attachment)
+			if err := fs.Remove(attachmentSrc); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove a deduplicated attachment: %w", err)
+			}
+		}
+
+		log.Printf("[INFO] deduplicated %s == %s", src, dest)
+		return nil
+	}, nil
+}
+
+// removeEmptyDir removes dir if it still exists and is empty, used to apply
+// an ActionRemoveEmptyDir.
+func removeEmptyDir(fs afero.Fs, dir string) error {
+	if exists, _ := afero.DirExists(fs, dir); !exists {
+		return nil
+	}
+
+	empty, err := afero.IsEmpty(fs, dir)
+	if err != nil {
+		return fmt.Errorf("failed to check if dir is empty: %w", err)
+	}
+	if !empty {
+		return nil
+	}
+
+	if err := fs.Remove(dir); err != nil {
+		return fmt.Errorf("failed to clean up a dir: %w", err)
+	}
+
+	return nil
+}
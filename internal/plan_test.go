@@ -0,0 +1,26 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyDedupeAtomicity(t *testing.T) {
+	mem := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(mem, "a/note.md", []byte("# Note\n"), 0o644))
+	require.NoError(t, afero.WriteFile(mem, "dest/note.md", []byte("# Note\n"), 0o644))
+
+	actions := []Action{
+		{Kind: ActionDedupe, Src: "a/note.md", Dest: "dest/note.md"},
+		{Kind: ActionRenameFile, Src: "missing.md", Dest: "dest/missing.md"},
+	}
+
+	err := Apply(mem, actions, false)
+	require.Error(t, err)
+
+	exists, err := afero.Exists(mem, "a/note.md")
+	require.NoError(t, err)
+	require.True(t, exists, "a deduplicated source must survive when a later action in the same batch fails")
+}
@@ -1,14 +1,17 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/logutils"
 	cli "github.com/integrii/flaggy"
@@ -29,16 +32,39 @@ func init() {
 
 func main() {
 	var src, dest string
+	var opts options
 	var debug bool
+	var dedupe, planFormat string
 	cli.AddPositionalValue(&src, "src", 1, true, "Source path")
 	cli.AddPositionalValue(&dest, "dest", 2, true, "Target destination")
 	cli.Bool(&debug, "v", "verbose", "enable debug logging")
+	cli.Bool(&opts.noRewrite, "", "no-rewrite", "Don't rewrite links pointing at moved files")
+	cli.Bool(&opts.keepSource, "", "copy", "Copy files instead of moving them, leaving the source tree untouched")
+	cli.Bool(&opts.dryRun, "n", "dry-run", "Compute and print the move plan without touching the filesystem")
+	cli.String(&opts.repoRoot, "", "repo-root", "Root directory to scan for links pointing at moved files (defaults to the source directory)")
+	planFormat = "text"
+	cli.String(&planFormat, "", "plan", "--dry-run output format: text (default) or json")
+	dedupe = string(internal.DedupeContent)
+	cli.String(&dedupe, "", "dedupe", "How to resolve a filename collision: off, content (default) or name")
 	cli.Parse()
 
 	setLogLevel(debug)
 
+	dedupeMode, err := parseDedupeMode(dedupe)
+	if err != nil {
+		log.Printf("[ERROR] %s", err)
+		os.Exit(1)
+	}
+	opts.dedupe = dedupeMode
+
+	opts.planFormat, err = parsePlanFormat(planFormat)
+	if err != nil {
+		log.Printf("[ERROR] %s", err)
+		os.Exit(1)
+	}
+
 	fs := afero.NewOsFs()
-	err := mv(fs, src, dest)
+	err = mv(fs, src, dest, opts)
 	if err != nil {
 		log.Printf("[ERROR] %s", err)
 		os.Exit(1)
@@ -47,15 +73,52 @@ func main() {
 }
 
 var (
-	errNoFilesFound  = errors.New("no markdown files found")
-	errNoFilesToMove = errors.New("no files to move")
-	errMoveMultiple  = errors.New("specify an existing directory as a destination for multiple markdown files")
-	errWrongTemplate = errors.New("incorrect template in the destination path")
+	errNoFilesFound   = errors.New("no markdown files found")
+	errNoFilesToMove  = errors.New("no files to move")
+	errMoveMultiple   = errors.New("specify an existing directory as a destination for multiple markdown files")
+	errWrongTemplate  = errors.New("incorrect template in the destination path")
+	errInvalidDedupe  = errors.New("--dedupe must be one of: off, content, name")
+	errInvalidPlanFmt = errors.New("--plan must be one of: text, json")
 )
 
-// mv moves files from source to destination
+// options bundles the CLI flags that apply uniformly to every file being
+// moved, so mv and plan don't need a growing positional-parameter list.
+type options struct {
+	repoRoot   string
+	noRewrite  bool
+	keepSource bool
+	dryRun     bool
+	planFormat string
+	dedupe     internal.DedupeMode
+}
+
+// parseDedupeMode validates a --dedupe flag value.
+func parseDedupeMode(value string) (internal.DedupeMode, error) {
+	switch internal.DedupeMode(value) {
+	case internal.DedupeOff, internal.DedupeContent, internal.DedupeName:
+		return internal.DedupeMode(value), nil
+	default:
+		return "", errInvalidDedupe
+	}
+}
+
+// parsePlanFormat validates a --plan flag value.
+func parsePlanFormat(value string) (string, error) {
+	switch value {
+	case "text", "json":
+		return value, nil
+	default:
+		return "", errInvalidPlanFmt
+	}
+}
+
+// mv moves files from source to destination.
 // It relies on the filesystem abstraction provided by afero library.
-func mv(fs afero.Fs, src, dest string) error {
+// When opts.keepSource is true, files are copied rather than moved and the
+// cleanup phase is skipped entirely, since the source tree is left as is.
+// When opts.dryRun is true, the computed plan is printed and nothing is
+// touched on fs.
+func mv(fs afero.Fs, src, dest string, opts options) error {
 	files, err := findFiles(fs, src)
 	if err != nil {
 		return err
@@ -66,22 +129,253 @@ func mv(fs afero.Fs, src, dest string) error {
 	// Collect paths to clean up before we move files
 	dirs := cleanupList(mdFiles)
 
-	err = moveFiles(fs, mdFiles, dest)
+	actions, moves, err := plan(fs, mdFiles, dest, !opts.noRewrite, opts.keepSource, opts.dedupe)
 	if err != nil {
 		return err
 	}
 
-	return cleanUp(fs, dirs)
+	root := opts.repoRoot
+	if root == "" {
+		root = commonRoot(sourceRoot(src), destRoot(fs, dest))
+	}
+
+	if opts.dryRun {
+		var refActions []internal.Action
+		if !opts.noRewrite && len(moves) > 0 {
+			touched, err := internal.PreviewReferenceRewrites(fs, root, moves)
+			if err != nil {
+				return err
+			}
+			for _, path := range touched {
+				refActions = append(refActions, internal.Action{Kind: internal.ActionRewriteLink, Dest: path})
+			}
+		}
+
+		var cleanupPreview []internal.Action
+		if !opts.keepSource {
+			cleanupPreview, err = previewDirActions(fs, dirs, mdFiles, actions)
+			if err != nil {
+				return err
+			}
+		}
+		all := append(append(append([]internal.Action{}, actions...), refActions...), cleanupPreview...)
+		return printPlan(all, opts.planFormat)
+	}
+
+	if err := internal.Apply(fs, actions, opts.keepSource); err != nil {
+		return err
+	}
+
+	if !opts.noRewrite && len(moves) > 0 {
+		if err := internal.RewriteReferences(fs, root, moves); err != nil {
+			return err
+		}
+	}
+
+	if opts.keepSource {
+		return nil
+	}
+
+	return internal.Apply(fs, dirActions(dirs), false)
+}
+
+// printPlan writes actions to stdout in the requested format ("text" or
+// "json"), for --dry-run.
+func printPlan(actions []internal.Action, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(actions)
+	}
+
+	for _, action := range actions {
+		fmt.Println(planLine(action))
+	}
+	return nil
+}
+
+// planLine renders a single Action as a human-readable line.
+func planLine(action internal.Action) string {
+	switch action.Kind {
+	case internal.ActionRenameFile:
+		return fmt.Sprintf("move %s -> %s", action.Src, action.Dest)
+	case internal.ActionRenameAttachment:
+		return fmt.Sprintf("move attachment %s -> %s", action.Src, action.Dest)
+	case internal.ActionDedupe:
+		return fmt.Sprintf("skip %s (duplicate of %s)", action.Src, action.Dest)
+	case internal.ActionRewriteLink:
+		return fmt.Sprintf("rewrite links in %s", action.Dest)
+	case internal.ActionRemoveEmptyDir:
+		return fmt.Sprintf("remove empty dir %s", action.Src)
+	default:
+		return fmt.Sprintf("%s %s -> %s", action.Kind, action.Src, action.Dest)
+	}
+}
+
+// dirActions builds ActionRemoveEmptyDir entries for dirs, deepest
+// directories first so nested empty dirs are removed before their parents.
+func dirActions(dirs []string) []internal.Action {
+	sorted := append([]string(nil), dirs...)
+	sort.Sort(sort.Reverse(sort.StringSlice(sorted)))
+
+	actions := make([]internal.Action, len(sorted))
+	for i, dir := range sorted {
+		actions[i] = internal.Action{Kind: internal.ActionRemoveEmptyDir, Src: dir}
+	}
+	return actions
+}
+
+// previewDirActions previews the ActionRemoveEmptyDir entries Apply would
+// actually perform for dirs, for --dry-run. Unlike dirActions, it doesn't
+// assert every candidate directory will end up empty: a source directory
+// can hold files the current move doesn't touch (an unmatched glob pattern,
+// a non-markdown file), and those are left behind at apply time. It checks
+// each directory's real contents against the paths the computed actions
+// would actually remove from it.
+func previewDirActions(fs afero.Fs, dirs []string, files []*internal.File, actions []internal.Action) ([]internal.Action, error) {
+	removed := make(map[string]struct{})
+	for _, action := range actions {
+		switch action.Kind {
+		case internal.ActionRenameFile, internal.ActionRenameAttachment:
+			removed[filepath.Clean(action.Src)] = struct{}{}
+		case internal.ActionDedupe:
+			removed[filepath.Clean(action.Src)] = struct{}{}
+			for _, attachment := range deduplicatedAttachments(files, action.Src) {
+				removed[filepath.Clean(attachment)] = struct{}{}
+			}
+		}
+	}
+
+	sorted := append([]string(nil), dirs...)
+	sort.Sort(sort.Reverse(sort.StringSlice(sorted)))
+
+	var previewed []internal.Action
+	for _, dir := range sorted {
+		empty, err := wouldBeEmpty(fs, dir, removed)
+		if err != nil {
+			return nil, err
+		}
+		if !empty {
+			continue
+		}
+		previewed = append(previewed, internal.Action{Kind: internal.ActionRemoveEmptyDir, Src: dir})
+		// A now-empty dir counts as removed too, so a parent whose only
+		// remaining entry is this dir is also previewed as removable.
+		removed[filepath.Clean(dir)] = struct{}{}
+	}
+
+	return previewed, nil
+}
+
+// deduplicatedAttachments finds the file originally at src among files and
+// returns the paths its attachments would be removed from alongside it, used
+// to predict removeDeduplicated's effect for previewDirActions.
+func deduplicatedAttachments(files []*internal.File, src string) []string {
+	for _, file := range files {
+		if filepath.Clean(file.Path) != filepath.Clean(src) {
+			continue
+		}
+
+		attachments := make([]string, len(file.Attachments))
+		for i, attachment := range file.Attachments {
+			attachments[i] = filepath.Join(filepath.Dir(file.Path), attachment)
+		}
+		return attachments
+	}
+	return nil
+}
+
+// wouldBeEmpty reports whether dir would have no entries left once every
+// path in removed is gone, without modifying the filesystem.
+func wouldBeEmpty(fs afero.Fs, dir string, removed map[string]struct{}) (bool, error) {
+	entries, err := afero.ReadDir(fs, dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	for _, entry := range entries {
+		if _, gone := removed[filepath.Clean(filepath.Join(dir, entry.Name()))]; !gone {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// sourceRoot derives a default root to scan for cross-file link rewriting
+// from the source pattern, when --repo-root isn't set.
+func sourceRoot(src string) string {
+	if idx := strings.IndexByte(src, '*'); idx >= 0 {
+		src = src[:idx]
+	}
+
+	if dir := filepath.Dir(filepath.FromSlash(src)); dir != "" {
+		return dir
+	}
+
+	return "."
+}
+
+// destRoot derives a default root to scan for cross-file link rewriting from
+// the destination, when --repo-root isn't set. An existing directory is its
+// own root; a template or a file path contributes the directory it resolves
+// under.
+func destRoot(fs afero.Fs, dest string) string {
+	if isDir(fs, dest) {
+		return filepath.Clean(dest)
+	}
+
+	if idx := strings.IndexByte(dest, '%'); idx >= 0 {
+		dest = dest[:idx]
+	}
+
+	if dir := filepath.Dir(filepath.FromSlash(dest)); dir != "" {
+		return dir
+	}
+
+	return "."
+}
+
+// commonRoot returns the nearest common ancestor directory of a and b. It's
+// used to derive a default --repo-root wide enough to see both sides of a
+// move: if links are only rewritten under the source directory, a file that
+// moved out of it (taking its own now-stale relative links along) is never
+// revisited to fix them up.
+func commonRoot(a, b string) string {
+	aParts := strings.Split(filepath.ToSlash(filepath.Clean(a)), "/")
+	bParts := strings.Split(filepath.ToSlash(filepath.Clean(b)), "/")
+
+	n := 0
+	for n < len(aParts) && n < len(bParts) && aParts[n] == bParts[n] {
+		n++
+	}
+	if n == 0 {
+		return "."
+	}
+
+	return filepath.Join(aParts[:n]...)
 }
 
 // findFiles accepts a filename, directories and glob patterns as an input
 // and returns a slice files matching the search criteria.
+// A `**` segment matches any number of directories, recursively.
 func findFiles(fs afero.Fs, path string) (files []string, err error) {
 	// If input is a directory, find all *.md files
 	if isDir(fs, path) {
 		path = filepath.FromSlash(path + "/*.md")
 	}
 
+	if strings.Contains(path, "**") {
+		files, err = globRecursive(fs, path)
+		if len(files) == 0 && err == nil {
+			err = errNoFilesFound
+		}
+
+		return
+	}
+
 	if strings.Contains(path, "*") {
 		files, err = afero.Glob(fs, path)
 		if files == nil {
@@ -96,6 +390,81 @@ func findFiles(fs afero.Fs, path string) (files []string, err error) {
 	return
 }
 
+// globRecursive matches a glob pattern containing `**` against fs.
+// It splits the pattern at the first `**` segment, walks the directory tree
+// rooted at the prefix before it, and matches the remaining segments
+// (which may contain further `**` segments) against each file found.
+func globRecursive(fs afero.Fs, pattern string) (matches []string, err error) {
+	segments := strings.Split(filepath.ToSlash(pattern), "/")
+
+	idx := -1
+	for i, s := range segments {
+		if s == "**" {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		return afero.Glob(fs, pattern)
+	}
+
+	root := strings.Join(segments[:idx], "/")
+	if root == "" {
+		root = "."
+	}
+	remainder := segments[idx:]
+
+	err = afero.Walk(fs, root, func(p string, info os.FileInfo, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, relErr := filepath.Rel(root, p)
+		if relErr != nil {
+			return relErr
+		}
+
+		if matchSegments(strings.Split(filepath.ToSlash(rel), "/"), remainder) {
+			matches = append(matches, p)
+		}
+		return nil
+	})
+
+	return
+}
+
+// matchSegments reports whether path (split into its `/`-separated
+// segments) matches pattern segments, where a `**` segment matches zero or
+// more path segments and any other segment is matched with filepath.Match.
+func matchSegments(path, pattern []string) bool {
+	if len(pattern) == 0 {
+		return len(path) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(path); i++ {
+			if matchSegments(path[i:], pattern[1:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(path) == 0 {
+		return false
+	}
+
+	ok, err := filepath.Match(pattern[0], path[0])
+	if err != nil || !ok {
+		return false
+	}
+
+	return matchSegments(path[1:], pattern[1:])
+}
+
 // parseFiles converts every filepath to an internal representation
 // suitable for further operations.
 func parseFiles(fs afero.Fs, files []string) []*internal.File {
@@ -112,16 +481,18 @@ func parseFiles(fs afero.Fs, files []string) []*internal.File {
 }
 
 // cleanupList prepares a list of existing directories
-// that might be empty after move operation.
+// that might be empty after move operation, including every intermediate
+// directory up to the root so deep trees left by recursive discovery can be
+// pruned too.
 func cleanupList(files []*internal.File) []string {
 	dirs := make(map[string]struct{})
 
 	// Find potential dirs to remove
 	for _, file := range files {
-		dirs[path.Dir(file.Path)] = struct{}{}
+		addAncestorDirs(dirs, path.Dir(file.Path))
 		for _, attachment := range file.Attachments {
 			attDir := filepath.Join(path.Dir(file.Path), path.Dir(attachment))
-			dirs[attDir] = struct{}{}
+			addAncestorDirs(dirs, attDir)
 		}
 	}
 
@@ -133,7 +504,23 @@ func cleanupList(files []*internal.File) []string {
 	return paths
 }
 
-// moveFiles decides where to move each file based on the destination definition.
+// addAncestorDirs adds dir and every one of its parent directories to dirs,
+// stopping at "." so unrelated directories above the working set are never
+// considered for cleanup.
+func addAncestorDirs(dirs map[string]struct{}, dir string) {
+	for dir != "." && dir != string(filepath.Separator) && dir != "" {
+		dirs[dir] = struct{}{}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return
+		}
+		dir = parent
+	}
+}
+
+// plan decides where to move each file based on the destination definition,
+// and returns the Actions that would perform it, without touching fs.
 //
 // Destination is a string representing on of the following:
 // * filename - only if the source is also a single file
@@ -142,87 +529,246 @@ func cleanupList(files []*internal.File) []string {
 //
 // A template like `path/%title%/index.md` will get replaced with the title
 // of the markdown file (not the filename, but the header text inside the file).
-func moveFiles(fs afero.Fs, files []*internal.File, dest string) error {
+// Any other `%key%` token is resolved against the file's frontmatter, with
+// dotted paths like `%taxonomies.category%` reaching into nested values and
+// `%key:2006/01%` formatting a date-like value with a Go reference layout.
+//
+// plan also returns a map of each moved file's original path to its new
+// path, so links elsewhere in the working set can be rewritten to match.
+// When rewriteLinks is true, an ActionRewriteLink is planned for each moved
+// file whose own links need updating to account for its move. dedupe
+// controls how a filename collision in a destination directory is resolved
+// (see internal.DedupeMode). When keepSource is true, each file is planned
+// to be copied to its destination rather than moved.
+func plan(fs afero.Fs, files []*internal.File, dest string, rewriteLinks, keepSource bool, dedupe internal.DedupeMode) ([]internal.Action, map[string]string, error) {
 	if len(files) == 0 {
-		return errNoFilesToMove
+		return nil, nil, errNoFilesToMove
 	}
 
-	tplFound, err := isTemplate(dest)
-	if err != nil {
-		return err
+	var actions []internal.Action
+	moves := make(map[string]string, len(files))
+
+	planOne := func(file *internal.File, fileActions []internal.Action) {
+		oldPath := filepath.Clean(file.Path)
+		oldDir := filepath.Dir(oldPath)
+
+		actions = append(actions, fileActions...)
+
+		for _, action := range fileActions {
+			if action.Kind != internal.ActionRenameFile {
+				continue
+			}
+			moves[oldPath] = action.Dest
+
+			if rewriteLinks && oldDir != filepath.Dir(action.Dest) {
+				actions = append(actions, internal.Action{Kind: internal.ActionRewriteLink, Src: oldDir, Dest: action.Dest})
+			}
+		}
 	}
 
-	if tplFound {
-		for _, file := range files {
-			err := file.Move(replaceTemplates(dest, file.Title))
+	if isTemplate(dest) {
+		// Resolve every destination before moving anything, so an
+		// unresolvable template aborts the whole operation up front.
+		dests := make([]string, len(files))
+		for i, file := range files {
+			d, err := replaceTemplates(dest, file)
 			if err != nil {
-				return err
+				return nil, nil, err
 			}
+			dests[i] = d
 		}
-		return nil
+
+		// Plan against a copy-on-write overlay, same as the directory
+		// branch below: two files whose resolved templates collide must go
+		// through the same dedupe/uniqueName handling instead of the second
+		// silently overwriting the first.
+		planFs := afero.NewCopyOnWriteFs(fs, afero.NewMemMapFs())
+		for i, file := range files {
+			planFile, err := internal.NewFile(planFs, file.Path)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			fileActions, err := planFile.PlanMoveTo(dests[i], dedupe, keepSource)
+			if err != nil {
+				return nil, nil, err
+			}
+			if err := stageActions(planFs, fileActions); err != nil {
+				return nil, nil, err
+			}
+			planOne(file, fileActions)
+		}
+		return actions, moves, nil
 	}
 
 	if isDir(fs, dest) {
+		// Plan against a copy-on-write overlay: collisions and content
+		// comparisons must account for files earlier in this same batch that
+		// haven't actually moved yet, the same way they would if Apply had
+		// already moved them.
+		planFs := afero.NewCopyOnWriteFs(fs, afero.NewMemMapFs())
 		for _, file := range files {
-			err := file.MoveToDir(dest)
+			planFile, err := internal.NewFile(planFs, file.Path)
 			if err != nil {
-				return err
+				return nil, nil, err
+			}
+
+			fileActions, err := planFile.PlanMoveToDir(dest, dedupe, keepSource)
+			if err != nil {
+				return nil, nil, err
+			}
+			if err := stageActions(planFs, fileActions); err != nil {
+				return nil, nil, err
 			}
+			planOne(file, fileActions)
 		}
-		return nil
+		return actions, moves, nil
 	}
 
 	if len(files) > 1 {
-		return errMoveMultiple
+		return nil, nil, errMoveMultiple
 	}
 
-	if err := files[0].Move(dest); err != nil {
-		return fmt.Errorf("failed to move a file: %w", err)
+	file := files[0]
+	planOne(file, file.PlanMove(dest))
+	return actions, moves, nil
+}
+
+// stageActions materializes a rename action's destination onto fs, without
+// touching its source. It's used to advance a copy-on-write planning
+// overlay after each file in a batch, so collision detection for the next
+// file sees earlier files as already moved.
+func stageActions(fs afero.Fs, actions []internal.Action) error {
+	for _, action := range actions {
+		if action.Kind != internal.ActionRenameFile && action.Kind != internal.ActionRenameAttachment {
+			continue
+		}
+
+		content, err := afero.ReadFile(fs, action.Src)
+		if err != nil {
+			return err
+		}
+		if err := fs.MkdirAll(filepath.Dir(action.Dest), os.ModePerm); err != nil {
+			return err
+		}
+		if err := afero.WriteFile(fs, action.Dest, content, os.ModePerm); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-// cleanUp removes directories that are empty, starting from the directories deep in the filesystem tree.
-func cleanUp(fs afero.Fs, keys []string) error {
-	// Put deep directories on top of the list
-	// To remove nested empty dirs first and parent dirs after
-	sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+// templateTokenRe matches a `%key%` or `%key:format%` template token.
+// key supports dotted paths into nested frontmatter values, e.g. `taxonomies.category`.
+var templateTokenRe = regexp.MustCompile(`%([a-zA-Z0-9_]+(?:\.[a-zA-Z0-9_]+)*)(?::([^%]+))?%`)
 
-	// Remove empty dirs from the source path
-	for _, dir := range keys {
-		if exists, _ := afero.DirExists(fs, dir); !exists {
-			continue
+// dateLayouts are the formats a frontmatter date value is tried against, in order.
+var dateLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"}
+
+// replaceTemplates expands every `%key%` token in tpl against file's title and
+// frontmatter. `%title%` falls back to the H1 title scanned from the file when
+// there is no `title` key in the frontmatter. A `%key:layout%` token formats a
+// date-like value using layout as a Go reference time layout. Any token that
+// can't be resolved returns errWrongTemplate.
+func replaceTemplates(tpl string, file *internal.File) (string, error) {
+	var resolveErr error
+
+	result := templateTokenRe.ReplaceAllStringFunc(tpl, func(token string) string {
+		if resolveErr != nil {
+			return token
 		}
-		if empty, err := afero.IsEmpty(fs, dir); empty && err == nil {
-			err := fs.Remove(dir)
-			if err != nil {
-				return fmt.Errorf("failed to clean up a dir: %w", err)
-			}
-		} else if err != nil {
-			return fmt.Errorf("failed to check if dir is empty: %w", err)
+
+		m := templateTokenRe.FindStringSubmatch(token)
+		key, layout := m[1], m[2]
+
+		value, ok := resolveTemplateValue(file, key)
+		if !ok {
+			resolveErr = errWrongTemplate
+			return token
+		}
+
+		str, err := formatTemplateValue(value, layout)
+		if err != nil {
+			resolveErr = errWrongTemplate
+			return token
 		}
+
+		return strings.ReplaceAll(str, string(filepath.Separator), "_")
+	})
+
+	if resolveErr != nil {
+		return "", resolveErr
 	}
 
-	return nil
+	return result, nil
 }
 
-// replaceTemplates replaces supported templates.
-func replaceTemplates(tpl string, title string) string {
-	escaped := strings.ReplaceAll(title, string(filepath.Separator), "_")
-	return strings.Replace(tpl, "%title%", escaped, 1)
+// resolveTemplateValue looks up key in the file's frontmatter, falling back
+// to the scanned H1 title for the special `title` key.
+func resolveTemplateValue(file *internal.File, key string) (any, bool) {
+	if value, ok := lookupDotted(file.Frontmatter, key); ok {
+		return value, true
+	}
+
+	if key == "title" {
+		return file.Title, true
+	}
+
+	return nil, false
 }
 
-// isTemplate checks if the string is a template.
-func isTemplate(path string) (bool, error) {
-	if !strings.Contains(path, "%") {
-		return false, nil
+// lookupDotted resolves a dotted path like "taxonomies.category" against
+// nested frontmatter maps.
+func lookupDotted(frontmatter map[string]any, keyPath string) (any, bool) {
+	var cur any = frontmatter
+	for _, part := range strings.Split(keyPath, ".") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		cur, ok = m[part]
+		if !ok {
+			return nil, false
+		}
 	}
+	return cur, true
+}
 
-	if !strings.Contains(path, "%title%") {
-		return false, errWrongTemplate
+// formatTemplateValue renders value as a string, or as a date formatted with
+// layout (a Go reference time layout) when layout is non-empty.
+func formatTemplateValue(value any, layout string) (string, error) {
+	if layout == "" {
+		return fmt.Sprintf("%v", value), nil
 	}
 
-	return true, nil
+	date, err := parseTemplateDate(value)
+	if err != nil {
+		return "", err
+	}
+
+	return date.Format(layout), nil
+}
+
+// parseTemplateDate coerces a frontmatter value into a time.Time, trying
+// dateLayouts in turn for string values.
+func parseTemplateDate(value any) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		for _, layout := range dateLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, nil
+			}
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("%q is not a recognized date value", value)
+}
+
+// isTemplate checks if the string is a template.
+func isTemplate(path string) bool {
+	return strings.Contains(path, "%")
 }
 
 // isDir checks if a given file path is a directory.
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/fs"
@@ -12,6 +13,8 @@ import (
 
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/require"
+
+	"github.com/wormi4ok/mdmv/internal"
 )
 
 func TestMv(t *testing.T) {
@@ -22,7 +25,7 @@ func TestMv(t *testing.T) {
 
 	copyFile(t, testFs, filepath.Join("testdata", src), src)
 
-	err := mv(testFs, src, dest)
+	err := mv(testFs, src, dest, testOpts("content", false, false))
 	require.NoError(t, err)
 
 	require.False(t, fileExists(testFs, src), "Source file still exists")
@@ -40,7 +43,7 @@ func TestMvToDir(t *testing.T) {
 	err := testFs.Mkdir(dest, os.ModePerm)
 	failOn(t, err, "create directory")
 
-	err = mv(testFs, file, dest)
+	err = mv(testFs, file, dest, testOpts("content", false, false))
 	require.NoError(t, err)
 
 	require.False(t, fileExists(testFs, file), "Source file exists")
@@ -63,13 +66,13 @@ func TestMvFromDir(t *testing.T) {
 	copyFile(t, testFs, filepath.Join("testdata", attachment), filepath.Join(src, attachment))
 
 	// At first, test if it fails with non-existing directory
-	err := mv(testFs, src, dest)
+	err := mv(testFs, src, dest, testOpts("content", false, false))
 	require.Error(t, err)
 
 	err = testFs.Mkdir(dest, os.ModePerm)
 	failOn(t, err, "create directory")
 
-	err = mv(testFs, src, dest)
+	err = mv(testFs, src, dest, testOpts("content", false, false))
 	require.NoError(t, err)
 
 	require.False(t, fileExists(testFs, filepath.Join(src, first)), "First source file exists")
@@ -101,7 +104,7 @@ func TestMvGlob(t *testing.T) {
 	err := testFs.Mkdir(dest, os.ModePerm)
 	failOn(t, err, "create directory")
 
-	err = mv(testFs, pattern, dest)
+	err = mv(testFs, pattern, dest, testOpts("content", false, false))
 	require.NoError(t, err)
 
 	require.False(t, fileExists(testFs, filepath.Join(folder1, sample)), "Source file exists")
@@ -116,6 +119,75 @@ func TestMvGlob(t *testing.T) {
 	require.True(t, fileExists(testFs, filepath.Join(dest, attachment)), "Attachment moved")
 }
 
+func TestMvGlobRecursiveTwoLevel(t *testing.T) {
+	sample := "sample.md"
+	second := "second.md"
+	attachment := "images/sample.png"
+	folder1 := "one/folder"
+	folder2 := "second/folder"
+
+	pattern := "**/*.md"
+	dest := "third folder"
+
+	testFs := newTmpFS(t)
+	copyFile(t, testFs, filepath.Join("testdata", sample), filepath.Join(folder1, sample))
+	copyFile(t, testFs, filepath.Join("testdata", attachment), filepath.Join(folder1, attachment))
+	copyFile(t, testFs, filepath.Join("testdata", second), filepath.Join(folder2, second))
+	err := testFs.Mkdir(dest, os.ModePerm)
+	failOn(t, err, "create directory")
+
+	err = mv(testFs, pattern, dest, testOpts("content", false, false))
+	require.NoError(t, err)
+
+	require.False(t, dirExists(testFs, "one"), "First source tree exists")
+	require.False(t, dirExists(testFs, "second"), "Second source tree exists")
+
+	require.True(t, fileExists(testFs, filepath.Join(dest, sample)), "First file moved")
+	require.True(t, fileExists(testFs, filepath.Join(dest, second)), "Second file moved")
+	require.True(t, fileExists(testFs, filepath.Join(dest, attachment)), "Attachment moved")
+}
+
+func TestMvGlobRecursiveThreeLevel(t *testing.T) {
+	sample := "sample.md"
+	folder := "one/two/three"
+
+	pattern := "**/**/*.md"
+	dest := "dest"
+
+	testFs := newTmpFS(t)
+	copyFile(t, testFs, filepath.Join("testdata", sample), filepath.Join(folder, sample))
+	err := testFs.Mkdir(dest, os.ModePerm)
+	failOn(t, err, "create directory")
+
+	err = mv(testFs, pattern, dest, testOpts("content", false, false))
+	require.NoError(t, err)
+
+	require.False(t, dirExists(testFs, "one"), "Source tree exists")
+	require.True(t, fileExists(testFs, filepath.Join(dest, sample)), "File moved")
+}
+
+func TestMvGlobRecursiveMixed(t *testing.T) {
+	sample := "sample.md"
+	folder := "docs/one/two"
+	other := "docs/other.md"
+
+	pattern := "docs/**/*.md"
+	dest := "dest"
+
+	testFs := newTmpFS(t)
+	copyFile(t, testFs, filepath.Join("testdata", sample), filepath.Join(folder, sample))
+	copyFile(t, testFs, filepath.Join("testdata", sample), other)
+	err := testFs.Mkdir(dest, os.ModePerm)
+	failOn(t, err, "create directory")
+
+	err = mv(testFs, pattern, dest, testOpts("content", false, false))
+	require.NoError(t, err)
+
+	require.False(t, dirExists(testFs, "docs"), "Source tree exists")
+	require.True(t, fileExists(testFs, filepath.Join(dest, sample)), "Nested file moved")
+	require.True(t, fileExists(testFs, filepath.Join(dest, "other.md")), "Top-level file moved")
+}
+
 func TestMvTemplateTitle(t *testing.T) {
 	wantTitle := "Sample file for testing purpose"
 	src := "sample.md"
@@ -126,7 +198,7 @@ func TestMvTemplateTitle(t *testing.T) {
 	copyFile(t, testFs, filepath.Join("testdata", src), src)
 	copyFile(t, testFs, filepath.Join("testdata", attachment), attachment)
 
-	err := mv(testFs, src, dest)
+	err := mv(testFs, src, dest, testOpts("content", false, false))
 	require.NoError(t, err)
 
 	require.False(t, fileExists(testFs, src), "Source file exists")
@@ -137,6 +209,57 @@ func TestMvTemplateTitle(t *testing.T) {
 	require.False(t, dirExists(testFs, filepath.Dir(attachment)), "Source attachment dir exists")
 }
 
+func TestMvTemplateFrontmatter(t *testing.T) {
+	src := "frontmatter.md"
+	attachment := "images/sample.png"
+	dest := "posts/%date:2006%/%slug%/index.md"
+	wantDir := filepath.Join("posts", "2024", "custom-slug")
+
+	testFs := newTmpFS(t)
+	copyFile(t, testFs, filepath.Join("testdata", src), src)
+	copyFile(t, testFs, filepath.Join("testdata", attachment), attachment)
+
+	err := mv(testFs, src, dest, testOpts("content", false, false))
+	require.NoError(t, err)
+
+	require.False(t, fileExists(testFs, src), "Source file exists")
+	require.True(t, fileExists(testFs, filepath.Join(wantDir, "index.md")), "File moved using frontmatter template")
+	require.True(t, fileExists(testFs, filepath.Join(wantDir, attachment)), "Attachment moved")
+}
+
+func TestMvTemplateCollision(t *testing.T) {
+	pattern := "*/note.md"
+	dest := "archive/%title%.md"
+
+	testFs := newTmpFS(t)
+	writeFile(t, testFs, "a/note.md", "# Same Title\n\nFirst body.\n")
+	writeFile(t, testFs, "b/note.md", "# Same Title\n\nSecond body.\n")
+
+	err := mv(testFs, pattern, dest, testOpts("content", false, false))
+	require.NoError(t, err)
+
+	require.True(t, fileExists(testFs, filepath.Join("archive", "Same Title.md")), "First file moved")
+	require.True(t, fileExists(testFs, filepath.Join("archive", "same title_1.md")), "Second file suffixed instead of overwriting the first")
+
+	first := readFile(t, testFs, filepath.Join("archive", "Same Title.md"))
+	require.Contains(t, first, "First body.", "first file's content should survive the collision")
+	second := readFile(t, testFs, filepath.Join("archive", "same title_1.md"))
+	require.Contains(t, second, "Second body.", "second file's content should be kept, not lost to an overwrite")
+}
+
+func TestMvTemplateUnknownKey(t *testing.T) {
+	src := "sample.md"
+	dest := "%not_a_real_key%/index.md"
+
+	testFs := newTmpFS(t)
+	copyFile(t, testFs, filepath.Join("testdata", src), src)
+
+	err := mv(testFs, src, dest, testOpts("content", false, false))
+	require.ErrorIs(t, err, errWrongTemplate)
+
+	require.True(t, fileExists(testFs, src), "Source file should not be moved")
+}
+
 func TestMvUnicode(t *testing.T) {
 	wantTitle := "Меры безопасности для защиты сервера _ petrashov.ru"
 	src := "unicode.md"
@@ -145,7 +268,7 @@ func TestMvUnicode(t *testing.T) {
 	testFs := newTmpFS(t)
 	copyFile(t, testFs, filepath.Join("testdata", src), src)
 
-	err := mv(testFs, src, dest)
+	err := mv(testFs, src, dest, testOpts("content", false, false))
 	require.NoError(t, err)
 
 	require.False(t, fileExists(testFs, src), "Source file exists")
@@ -163,7 +286,7 @@ func TestMissingAttachment(t *testing.T) {
 	err := testFs.Mkdir(dest, os.ModePerm)
 	failOn(t, err, "create directory")
 
-	err = mv(testFs, src, dest)
+	err = mv(testFs, src, dest, testOpts("content", false, false))
 
 	require.NoError(t, err)
 	require.Contains(t, v.String(), "attachment is missing", "A warning should be logged")
@@ -189,7 +312,7 @@ func TestFilenameCollision(t *testing.T) {
 	err := testFs.Mkdir(dest, os.ModePerm)
 	failOn(t, err, "create directory")
 
-	err = mv(testFs, src, dest)
+	err = mv(testFs, src, dest, testOpts("content", false, false))
 	require.NoError(t, err)
 
 	require.Contains(t, v.String(), "same name", "A warning should be logged")
@@ -203,6 +326,300 @@ func TestFilenameCollision(t *testing.T) {
 	require.True(t, fileExists(testFs, filepath.Join(dest, "index_2.md")), "Third file moved")
 }
 
+func TestMvRewriteOwnLinks(t *testing.T) {
+	src := "src/note.md"
+	dest := "dest/note.md"
+
+	testFs := newTmpFS(t)
+	writeFile(t, testFs, src, "# Note\n\nSee [other note](other.md) for details.\n")
+	writeFile(t, testFs, "src/other.md", "# Other\n")
+
+	err := mv(testFs, src, dest, testOpts("content", false, false))
+	require.NoError(t, err)
+
+	content := readFile(t, testFs, dest)
+	require.Contains(t, content, "[other note](../src/other.md)", "link should be rewritten relative to the new location")
+}
+
+func TestMvRewriteReferences(t *testing.T) {
+	note := "note.md"
+	refs := "refs.md"
+	dest := "archive"
+
+	testFs := newTmpFS(t)
+	writeFile(t, testFs, note, "# Note\n")
+	writeFile(t, testFs, refs, "# References\n\nSee [the note](note.md) for details.\n")
+	err := testFs.Mkdir(dest, os.ModePerm)
+	failOn(t, err, "create directory")
+
+	err = mv(testFs, note, dest, testOpts("content", false, false))
+	require.NoError(t, err)
+
+	content := readFile(t, testFs, refs)
+	require.Contains(t, content, "[the note](archive/note.md)", "link elsewhere should be rewritten to the new location")
+}
+
+func TestMvGlobCrossLinkedDefaultRoot(t *testing.T) {
+	pattern := "src/*.md"
+	dest := "dest"
+
+	testFs := newTmpFS(t)
+	writeFile(t, testFs, "src/a.md", "# A\n\nSee [B](b.md) for details.\n")
+	writeFile(t, testFs, "src/b.md", "# B\n")
+	err := testFs.Mkdir(dest, os.ModePerm)
+	failOn(t, err, "create directory")
+
+	err = mv(testFs, pattern, dest, testOpts("content", false, false))
+	require.NoError(t, err)
+
+	content := readFile(t, testFs, filepath.Join(dest, "a.md"))
+	require.Contains(t, content, "[B](b.md)", "link to a file moved alongside it should still resolve under the default --repo-root")
+}
+
+func TestMvNoRewrite(t *testing.T) {
+	note := "note.md"
+	refs := "refs.md"
+	dest := "archive"
+
+	testFs := newTmpFS(t)
+	writeFile(t, testFs, note, "# Note\n")
+	writeFile(t, testFs, refs, "# References\n\nSee [the note](note.md) for details.\n")
+	err := testFs.Mkdir(dest, os.ModePerm)
+	failOn(t, err, "create directory")
+
+	err = mv(testFs, note, dest, testOpts("content", true, false))
+	require.NoError(t, err)
+
+	content := readFile(t, testFs, refs)
+	require.Contains(t, content, "[the note](note.md)", "link should be left untouched with --no-rewrite")
+}
+
+func TestDedupeContentIdentical(t *testing.T) {
+	pattern := "*/note.md"
+	dest := "dest"
+
+	testFs := newTmpFS(t)
+	writeFile(t, testFs, "a/note.md", "# Note\n\nSame content.\n")
+	writeFile(t, testFs, "b/note.md", "# Note\n\nSame content.\n")
+	err := testFs.Mkdir(dest, os.ModePerm)
+	failOn(t, err, "create directory")
+
+	v := &bytes.Buffer{}
+	log.SetOutput(v)
+
+	err = mv(testFs, pattern, dest, testOpts("content", false, false))
+	require.NoError(t, err)
+
+	require.Contains(t, v.String(), "deduplicated", "A deduplication message should be logged")
+
+	require.True(t, fileExists(testFs, filepath.Join(dest, "note.md")), "First file moved")
+	require.False(t, fileExists(testFs, filepath.Join(dest, "note_1.md")), "Duplicate should not be suffixed")
+	require.False(t, dirExists(testFs, "a"), "First source directory exists")
+	require.False(t, dirExists(testFs, "b"), "Second source directory exists")
+}
+
+func TestDedupeContentDifferent(t *testing.T) {
+	pattern := "*/note.md"
+	dest := "dest"
+
+	testFs := newTmpFS(t)
+	writeFile(t, testFs, "a/note.md", "# Note\n\nFirst version.\n")
+	writeFile(t, testFs, "b/note.md", "# Note\n\nSecond version.\n")
+	err := testFs.Mkdir(dest, os.ModePerm)
+	failOn(t, err, "create directory")
+
+	err = mv(testFs, pattern, dest, testOpts("content", false, false))
+	require.NoError(t, err)
+
+	require.True(t, fileExists(testFs, filepath.Join(dest, "note.md")), "First file moved")
+	require.True(t, fileExists(testFs, filepath.Join(dest, "note_1.md")), "Differing file should be suffixed, not deduplicated")
+}
+
+func TestDedupeContentThreeWayMix(t *testing.T) {
+	pattern := "*/note.md"
+	dest := "dest"
+
+	testFs := newTmpFS(t)
+	writeFile(t, testFs, "a/note.md", "# Note\n\nShared content.\n")
+	writeFile(t, testFs, "b/note.md", "# Note\n\nShared content.\n")
+	writeFile(t, testFs, "c/note.md", "# Note\n\nDifferent content.\n")
+	err := testFs.Mkdir(dest, os.ModePerm)
+	failOn(t, err, "create directory")
+
+	err = mv(testFs, pattern, dest, testOpts("content", false, false))
+	require.NoError(t, err)
+
+	require.True(t, fileExists(testFs, filepath.Join(dest, "note.md")), "First file moved")
+	require.True(t, fileExists(testFs, filepath.Join(dest, "note_1.md")), "Differing file should be suffixed")
+	require.False(t, fileExists(testFs, filepath.Join(dest, "note_2.md")), "Duplicate should not consume a suffix slot")
+}
+
+func TestDedupeContentAttachmentsDiffer(t *testing.T) {
+	pattern := "*/note.md"
+	dest := "dest"
+
+	testFs := newTmpFS(t)
+	writeFile(t, testFs, "a/note.md", "# Note\n\nSame content.\n\n![img](image.png)\n")
+	writeFile(t, testFs, "b/note.md", "# Note\n\nSame content.\n\n![img](image.png)\n")
+	writeFile(t, testFs, "a/image.png", "first image bytes")
+	writeFile(t, testFs, "b/image.png", "second image bytes")
+	err := testFs.Mkdir(dest, os.ModePerm)
+	failOn(t, err, "create directory")
+
+	v := &bytes.Buffer{}
+	log.SetOutput(v)
+
+	err = mv(testFs, pattern, dest, testOpts("content", false, false))
+	require.NoError(t, err)
+
+	require.NotContains(t, v.String(), "deduplicated", "docs with differing attachments must not be treated as duplicates")
+	require.True(t, fileExists(testFs, filepath.Join(dest, "note.md")), "First file moved")
+	require.True(t, fileExists(testFs, filepath.Join(dest, "note_1.md")), "Second file suffixed instead of deduplicated")
+}
+
+func TestDedupeOff(t *testing.T) {
+	file := "note.md"
+	dest := "dest"
+
+	testFs := newTmpFS(t)
+	writeFile(t, testFs, file, "# New\n")
+	writeFile(t, testFs, filepath.Join(dest, file), "# Existing\n")
+
+	err := mv(testFs, file, dest, testOpts("off", false, false))
+	require.NoError(t, err)
+
+	require.Equal(t, "# New\n", readFile(t, testFs, filepath.Join(dest, file)), "destination should be overwritten")
+}
+
+func TestMvCopyKeepsSource(t *testing.T) {
+	file := "sample.md"
+	attachment := "images/sample.png"
+	dest := "folder"
+
+	testFs := newTmpFS(t)
+	copyFile(t, testFs, filepath.Join("testdata", file), file)
+	copyFile(t, testFs, filepath.Join("testdata", attachment), attachment)
+	err := testFs.Mkdir(dest, os.ModePerm)
+	failOn(t, err, "create directory")
+
+	err = mv(testFs, file, dest, testOpts("content", false, true))
+	require.NoError(t, err)
+
+	require.True(t, fileExists(testFs, file), "source file should be kept")
+	require.True(t, fileExists(testFs, attachment), "source attachment should be kept")
+	require.True(t, fileExists(testFs, filepath.Join(dest, file)), "file copied to destination")
+	require.True(t, fileExists(testFs, filepath.Join(dest, attachment)), "attachment copied to destination")
+}
+
+func TestMvDryRun(t *testing.T) {
+	file := "sample.md"
+	attachment := "images/sample.png"
+	dest := "folder"
+
+	testFs := newTmpFS(t)
+	copyFile(t, testFs, filepath.Join("testdata", file), file)
+	copyFile(t, testFs, filepath.Join("testdata", attachment), attachment)
+	err := testFs.Mkdir(dest, os.ModePerm)
+	failOn(t, err, "create directory")
+
+	opts := testOpts("content", false, false)
+	opts.dryRun = true
+
+	out := captureStdout(t, func() {
+		err = mv(testFs, file, dest, opts)
+		require.NoError(t, err)
+	})
+
+	require.Contains(t, out, fmt.Sprintf("move %s -> %s", file, filepath.Join(dest, file)))
+	require.Contains(t, out, fmt.Sprintf("move attachment %s -> %s", attachment, filepath.Join(dest, attachment)))
+
+	require.True(t, fileExists(testFs, file), "source file should be untouched by a dry run")
+	require.True(t, fileExists(testFs, attachment), "source attachment should be untouched by a dry run")
+	require.False(t, fileExists(testFs, filepath.Join(dest, file)), "dry run should not create the destination file")
+}
+
+func TestMvDryRunLeavesNonEmptyDirAlone(t *testing.T) {
+	src := "src"
+	dest := "dest"
+
+	testFs := newTmpFS(t)
+	writeFile(t, testFs, filepath.Join(src, "a.md"), "# A\n")
+	writeFile(t, testFs, filepath.Join(src, "notes.txt"), "not matched by the glob\n")
+	err := testFs.Mkdir(dest, os.ModePerm)
+	failOn(t, err, "create directory")
+
+	opts := testOpts("content", false, false)
+	opts.dryRun = true
+
+	out := captureStdout(t, func() {
+		err = mv(testFs, filepath.Join(src, "*.md"), dest, opts)
+		require.NoError(t, err)
+	})
+
+	require.NotContains(t, out, "remove empty dir src", "src still holds notes.txt and a real run would leave it in place")
+	require.True(t, fileExists(testFs, filepath.Join(src, "notes.txt")), "dry run should not touch the filesystem")
+}
+
+func TestMvDryRunJSON(t *testing.T) {
+	file := "second.md"
+	dest := "dest.md"
+
+	testFs := newTmpFS(t)
+	copyFile(t, testFs, filepath.Join("testdata", file), file)
+
+	opts := testOpts("content", false, false)
+	opts.dryRun = true
+	opts.planFormat = "json"
+
+	var err error
+	out := captureStdout(t, func() {
+		err = mv(testFs, file, dest, opts)
+		require.NoError(t, err)
+	})
+
+	var actions []internal.Action
+	require.NoError(t, json.Unmarshal([]byte(out), &actions), "plan output should be valid JSON")
+	require.Len(t, actions, 1)
+	require.Equal(t, internal.ActionRenameFile, actions[0].Kind)
+	require.Equal(t, file, actions[0].Src)
+	require.Equal(t, dest, actions[0].Dest)
+
+	require.False(t, fileExists(testFs, dest), "dry run should not create the destination file")
+}
+
+// captureStdout redirects os.Stdout for the duration of fn and returns
+// everything written to it.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	failOn(t, err, "create pipe")
+
+	original := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = original }()
+
+	fn()
+
+	failOn(t, w.Close(), "close pipe")
+	captured, err := io.ReadAll(r)
+	failOn(t, err, "read captured output")
+
+	return string(captured)
+}
+
+// testOpts builds an options value for tests that only care about the
+// dedupe mode and the noRewrite/keepSource flags, leaving dry-run and repo
+// root at their zero values.
+func testOpts(dedupe string, noRewrite, keepSource bool) options {
+	return options{
+		noRewrite:  noRewrite,
+		keepSource: keepSource,
+		planFormat: "text",
+		dedupe:     internal.DedupeMode(dedupe),
+	}
+}
+
 func newTmpFS(t *testing.T) afero.Fs {
 	t.Helper()
 	testFs := afero.NewBasePathFs(afero.NewOsFs(), t.TempDir())
@@ -271,3 +688,23 @@ func copyFile(t *testing.T, fs afero.Fs, src, dest string) {
 		t.Fatal("no data was copied")
 	}
 }
+
+func writeFile(t *testing.T, fs afero.Fs, path, content string) {
+	t.Helper()
+
+	if !dirExists(fs, filepath.Dir(path)) {
+		err := fs.MkdirAll(filepath.Dir(path), os.ModePerm)
+		failOn(t, err, "create directory tree")
+	}
+
+	err := afero.WriteFile(fs, path, []byte(content), os.ModePerm)
+	failOn(t, err, "write file")
+}
+
+func readFile(t *testing.T, fs afero.Fs, path string) string {
+	t.Helper()
+
+	content, err := afero.ReadFile(fs, path)
+	failOn(t, err, "read file")
+	return string(content)
+}